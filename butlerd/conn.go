@@ -0,0 +1,32 @@
+package butlerd
+
+import "context"
+
+// Conn is the Notify/Call/Close interface shared by butlerd's
+// connection wrappers: the named-pipe connections from
+// butlerd/pipeconn.NewConn and test doubles like
+// cmd/operate/loopbackconn. Handlers started by Serve, over loopback
+// TCP or the named pipe, are jsonrpc2.Handlers and receive the
+// underlying *jsonrpc2.Conn, not a Conn.
+type Conn interface {
+	Notify(ctx context.Context, method string, params interface{}) error
+	Call(ctx context.Context, method string, params interface{}, result interface{}) error
+	Close() error
+}
+
+// LogLevel mirrors the levels butler's own comm package logs at.
+type LogLevel string
+
+const (
+	LogLevelDebug LogLevel = "debug"
+	LogLevelInfo  LogLevel = "info"
+	LogLevelWarn  LogLevel = "warning"
+	LogLevelError LogLevel = "error"
+)
+
+// LogNotification is sent by butlerd to report progress and diagnostic
+// messages that don't fit any specific in-flight call's result.
+type LogNotification struct {
+	Level   LogLevel `json:"level"`
+	Message string   `json:"message"`
+}
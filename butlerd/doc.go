@@ -0,0 +1,5 @@
+// Package butlerd implements butler's JSON-RPC daemon mode: a
+// long-running process that wraps butler's commands (install, launch,
+// diff, ...) behind a stable API, so GUI clients like itch-desktop and
+// itch-setup don't have to shell out to one-shot CLI invocations.
+package butlerd
@@ -0,0 +1,38 @@
+package butlerd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHandshakeOmitsEmptyPipe(t *testing.T) {
+	h := Handshake{Type: "butlerd/handshake", Address: "127.0.0.1:1234"}
+
+	buf, err := json.Marshal(h)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err.Error())
+	}
+
+	if strings.Contains(string(buf), "pipe") {
+		t.Fatalf("expected no pipe field when Pipe is empty, got %s", buf)
+	}
+}
+
+func TestHandshakeIncludesPipeWhenSet(t *testing.T) {
+	h := Handshake{Type: "butlerd/handshake", Address: "127.0.0.1:1234", Pipe: `\\.\pipe\butlerd-abc`}
+
+	buf, err := json.Marshal(h)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err.Error())
+	}
+
+	var decoded Handshake
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %s", err.Error())
+	}
+
+	if decoded.Pipe != h.Pipe {
+		t.Fatalf("expected pipe %q to round-trip, got %q", h.Pipe, decoded.Pipe)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package butlerd
+
+import (
+	"context"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func init() {
+	startPipeTransport = servePipe
+}
+
+// servePipe is a no-op on platforms without a named-pipe transport; see
+// pipe_windows.go for the real Windows implementation.
+func servePipe(ctx context.Context, session string, handler jsonrpc2.Handler) (string, func() error, error) {
+	return "", func() error { return nil }, nil
+}
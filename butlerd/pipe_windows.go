@@ -0,0 +1,22 @@
+package butlerd
+
+import (
+	"context"
+
+	"github.com/itchio/butler/butlerd/pipeconn"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func init() {
+	startPipeTransport = servePipe
+}
+
+// servePipe starts the named-pipe transport alongside the primary TCP
+// listener, returning its path so Serve can fold it into the handshake.
+func servePipe(ctx context.Context, session string, handler jsonrpc2.Handler) (string, func() error, error) {
+	server, err := pipeconn.Serve(ctx, session, handler)
+	if err != nil {
+		return "", nil, err
+	}
+	return server.HandshakeInfo().Pipe, server.Close, nil
+}
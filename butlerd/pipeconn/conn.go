@@ -0,0 +1,47 @@
+package pipeconn
+
+import (
+	"context"
+	"net"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Conn is the same shape as butlerd.Conn (Notify/Call/Close), restated
+// here instead of imported so this package doesn't have to depend on
+// butlerd — butlerd depends on pipeconn to serve the pipe transport, and
+// Go doesn't allow the reverse import too.
+type Conn interface {
+	Notify(ctx context.Context, method string, params interface{}) error
+	Call(ctx context.Context, method string, params interface{}, result interface{}) error
+	Close() error
+}
+
+// wireConn adapts a jsonrpc2.Conn running over a named pipe net.Conn to
+// Conn.
+type wireConn struct {
+	rpc *jsonrpc2.Conn
+}
+
+var _ Conn = (*wireConn)(nil)
+
+// NewConn wraps an accepted (or dialed) pipe connection into a Conn,
+// using the same JSON-RPC codec as butlerd's TCP transport.
+func NewConn(ctx context.Context, conn net.Conn, handler jsonrpc2.Handler) Conn {
+	stream := jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{})
+	return &wireConn{
+		rpc: jsonrpc2.NewConn(ctx, stream, handler),
+	}
+}
+
+func (wc *wireConn) Notify(ctx context.Context, method string, params interface{}) error {
+	return wc.rpc.Notify(ctx, method, params)
+}
+
+func (wc *wireConn) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	return wc.rpc.Call(ctx, method, params, result)
+}
+
+func (wc *wireConn) Close() error {
+	return wc.rpc.Close()
+}
@@ -0,0 +1,9 @@
+// Package pipeconn implements a Windows named-pipe transport for
+// butlerd, as an alternative to the loopback TCP listener. It lets
+// clients like itch-setup and itch-desktop talk to butler without
+// opening a TCP port, which some firewalls and antivirus products flag.
+//
+// Serve is the entry point: it starts accepting connections on the
+// pipe and returns a Server whose HandshakeInfo should be folded into
+// the daemon's handshake JSON so clients can discover the pipe path.
+package pipeconn
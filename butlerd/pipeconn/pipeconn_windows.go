@@ -0,0 +1,63 @@
+package pipeconn
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+	"golang.org/x/sys/windows"
+)
+
+// PipeName returns the name of the named pipe butlerd listens on for a
+// given session, e.g. `\\.\pipe\butlerd-<session>`. Clients that learn
+// the session id from the daemon handshake can derive the pipe name
+// themselves without further IPC.
+func PipeName(session string) string {
+	return fmt.Sprintf(`\\.\pipe\butlerd-%s`, session)
+}
+
+// currentUserSDDL builds a security descriptor that grants full access
+// to the current user's SID and nobody else, so the pipe carries the
+// same "only this user" guarantee as the loopback TCP listener's OS
+// firewall prompt is meant to provide, without the prompt.
+func currentUserSDDL() (string, error) {
+	token := windows.GetCurrentProcessToken()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return "", fmt.Errorf("getting current user token: %w", err)
+	}
+
+	sid, err := user.User.Sid.String()
+	if err != nil {
+		return "", fmt.Errorf("stringifying current user SID: %w", err)
+	}
+
+	return fmt.Sprintf("D:P(A;;GA;;;%s)", sid), nil
+}
+
+// Listen opens a named pipe at name (see PipeName), restricted to the
+// current user, ready to accept butlerd connections. Accepted
+// connections are plain net.Conn; callers are expected to wrap them
+// with NewConn, which uses the same JSON-RPC codec as butlerd's TCP
+// transport.
+func Listen(name string) (net.Listener, error) {
+	sddl, err := currentUserSDDL()
+	if err != nil {
+		return nil, err
+	}
+
+	return winio.ListenPipe(name, &winio.PipeConfig{
+		SecurityDescriptor: sddl,
+		MessageMode:        false,
+		InputBufferSize:    64 * 1024,
+		OutputBufferSize:   64 * 1024,
+	})
+}
+
+// Dial connects to a named pipe previously opened with Listen. It
+// honors ctx cancellation while waiting for the pipe to become
+// available, via go-winio's overlapped I/O handle.
+func Dial(ctx context.Context, name string) (net.Conn, error) {
+	return winio.DialPipeContext(ctx, name)
+}
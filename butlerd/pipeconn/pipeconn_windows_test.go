@@ -0,0 +1,19 @@
+package pipeconn
+
+import "testing"
+
+func TestPipeNameIncludesSession(t *testing.T) {
+	name := PipeName("abc123")
+	want := `\\.\pipe\butlerd-abc123`
+	if name != want {
+		t.Fatalf("expected %q, got %q", want, name)
+	}
+}
+
+func TestHandshakeInfoCarriesServerName(t *testing.T) {
+	s := &Server{name: PipeName("abc123")}
+	info := s.HandshakeInfo()
+	if info.Pipe != s.name {
+		t.Fatalf("expected HandshakeInfo.Pipe to be %q, got %q", s.name, info.Pipe)
+	}
+}
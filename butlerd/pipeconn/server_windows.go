@@ -0,0 +1,106 @@
+package pipeconn
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// HandshakeInfo is the fragment a daemon handshake should embed (next to
+// its existing TCP address) so that clients which prefer the named-pipe
+// transport can connect without any extra round-trip to discover it.
+type HandshakeInfo struct {
+	// Pipe is the named pipe path returned by PipeName, e.g.
+	// `\\.\pipe\butlerd-<session>`. Always set for a running Server;
+	// butlerd.Serve fails outright if the pipe transport can't be
+	// started.
+	Pipe string `json:"pipe,omitempty"`
+}
+
+// Server accepts butlerd connections over a named pipe, handing each
+// one to NewConn the same way the TCP listener does. It's the
+// reachable, client-facing counterpart to Listen/Dial/NewConn: creating
+// a Server is what actually puts those on a path a client can use.
+type Server struct {
+	name     string
+	listener net.Listener
+	handler  jsonrpc2.Handler
+
+	wg sync.WaitGroup
+
+	mu    sync.Mutex
+	conns []*wireConn
+}
+
+// Serve starts listening on the named pipe for session (see PipeName)
+// and accepts connections in the background until ctx is cancelled or
+// Close is called. Each accepted connection is wrapped with NewConn and
+// dispatched to handler, exactly like the TCP transport.
+func Serve(ctx context.Context, session string, handler jsonrpc2.Handler) (*Server, error) {
+	name := PipeName(session)
+	listener, err := Listen(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		name:     name,
+		listener: listener,
+		handler:  handler,
+	}
+
+	s.wg.Add(1)
+	go s.acceptLoop(ctx)
+
+	go func() {
+		<-ctx.Done()
+		s.listener.Close()
+	}()
+
+	return s, nil
+}
+
+func (s *Server) acceptLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// either ctx was cancelled (closing the listener, which is
+			// the expected way this loop ends) or a real accept error:
+			// either way there's nothing left to accept.
+			return
+		}
+
+		wc := NewConn(ctx, conn, s.handler).(*wireConn)
+		s.mu.Lock()
+		s.conns = append(s.conns, wc)
+		s.mu.Unlock()
+	}
+}
+
+// HandshakeInfo returns the fragment describing this server, for the
+// daemon to embed in its handshake JSON alongside its other transports.
+func (s *Server) HandshakeInfo() HandshakeInfo {
+	return HandshakeInfo{Pipe: s.name}
+}
+
+// Close stops accepting new connections and closes every connection
+// accepted so far, then waits for the accept loop to exit.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+
+	s.wg.Wait()
+	return err
+}
@@ -0,0 +1,83 @@
+package butlerd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Handshake is the single JSON line Serve prints to stdout once it's
+// ready to accept connections, so wrapper processes like itch-setup and
+// itch-desktop can discover how to reach it without scraping logs.
+type Handshake struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	// Pipe is the named pipe path from butlerd/pipeconn (see PipeName),
+	// set on Windows only. Clients that prefer it over TCP can connect
+	// there instead, without opening a TCP port.
+	Pipe string `json:"pipe,omitempty"`
+}
+
+// startPipeTransport optionally starts an additional transport
+// alongside the primary TCP listener, returning the fragment to fold
+// into the handshake and a func to shut it down. Implemented for real
+// on Windows (pipe_windows.go, backed by butlerd/pipeconn); a no-op
+// everywhere else (pipe_other.go).
+var startPipeTransport func(ctx context.Context, session string, handler jsonrpc2.Handler) (pipe string, close func() error, err error)
+
+// Serve starts listening for butlerd connections on loopback TCP (and,
+// on Windows, additionally on a named pipe), prints the handshake line
+// to stdout, then accepts connections in the background until ctx is
+// cancelled.
+func Serve(ctx context.Context, session string, handler jsonrpc2.Handler) (net.Listener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("starting TCP listener: %w", err)
+	}
+
+	pipe, closePipe, err := startPipeTransport(ctx, session, handler)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("starting pipe transport: %w", err)
+	}
+
+	handshake := Handshake{
+		Type:    "butlerd/handshake",
+		Address: listener.Addr().String(),
+		Pipe:    pipe,
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(handshake); err != nil {
+		closePipe()
+		listener.Close()
+		return nil, fmt.Errorf("writing handshake: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		closePipe()
+		listener.Close()
+	}()
+
+	go acceptLoop(ctx, listener, handler)
+
+	return listener, nil
+}
+
+func acceptLoop(ctx context.Context, listener net.Listener, handler jsonrpc2.Handler) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// either ctx was cancelled (closing the listener, which is
+			// the expected way this loop ends) or a real accept error:
+			// either way there's nothing left to accept.
+			return
+		}
+
+		stream := jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{})
+		jsonrpc2.NewConn(ctx, stream, handler)
+	}
+}
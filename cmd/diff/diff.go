@@ -2,13 +2,20 @@ package diff
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/itchio/butler/comm"
 	"github.com/itchio/butler/filtering"
 	"github.com/itchio/butler/mansion"
+	"github.com/itchio/butler/sigcache"
 	"github.com/itchio/httpkit/progress"
 	"github.com/itchio/savior/seeksource"
 	"github.com/itchio/wharf/counter"
@@ -24,10 +31,13 @@ import (
 )
 
 var args = struct {
-	old    *string
-	new    *string
-	patch  *string
-	verify *bool
+	old        *string
+	new        *string
+	patch      *string
+	verify     *bool
+	sigCache   *string
+	noSigCache *bool
+	jobs       *int
 }{}
 
 func Register(ctx *mansion.Context) {
@@ -36,6 +46,9 @@ func Register(ctx *mansion.Context) {
 	args.new = cmd.Arg("new", "Directory or .zip archive (slower) with newer files").Required().String()
 	args.patch = cmd.Arg("patch", "Path to write the patch file (recommended extension is `.pwr`) The signature file will be written to the same path, with .sig added to the end.").Default("patch.pwr").String()
 	args.verify = cmd.Flag("verify", "Make sure generated patch applies cleanly by applying it (slower)").Bool()
+	args.sigCache = cmd.Flag("sig-cache", "Directory to store cached target signatures in, to skip re-hashing unchanged inputs").String()
+	args.noSigCache = cmd.Flag("no-sig-cache", "Disable the signature cache entirely").Bool()
+	args.jobs = cmd.Flag("jobs", "Number of worker goroutines to use for signature computation and verification").Default(strconv.Itoa(runtime.GOMAXPROCS(0))).Int()
 	ctx.Register(cmd, do)
 }
 
@@ -49,6 +62,15 @@ type Params struct {
 	Compression pwr.CompressionSettings
 	// Verify enables dry-run apply patch validation (slow)
 	Verify bool
+	// SigCache is the directory to store the signature cache in. If
+	// empty, sigcache.DefaultDir is used, unless NoSigCache is set.
+	SigCache string
+	// NoSigCache disables the signature cache entirely.
+	NoSigCache bool
+	// Jobs is the number of worker goroutines to use for signature
+	// computation and (when Verify is set) verification. Defaults to
+	// GOMAXPROCS when zero.
+	Jobs int
 }
 
 func do(ctx *mansion.Context) {
@@ -58,9 +80,112 @@ func do(ctx *mansion.Context) {
 		Patch:       *args.patch,
 		Compression: ctx.CompressionSettings(),
 		Verify:      *args.verify,
+		SigCache:    *args.sigCache,
+		NoSigCache:  *args.noSigCache,
+		Jobs:        *args.jobs,
 	}))
 }
 
+// openSigCache opens the signature cache described by params, or returns
+// a nil cache (disabling the feature) if NoSigCache is set or the cache
+// directory can't be determined/opened.
+func openSigCache(params *Params) *sigcache.Cache {
+	if params.NoSigCache {
+		return nil
+	}
+
+	dir := params.SigCache
+	if dir == "" {
+		var err error
+		dir, err = sigcache.DefaultDir()
+		if err != nil {
+			comm.Debugf("sig-cache: could not determine default dir: %s", err.Error())
+			return nil
+		}
+	}
+
+	cache, err := sigcache.Open(dir)
+	if err != nil {
+		comm.Debugf("sig-cache: could not open: %s", err.Error())
+		return nil
+	}
+	return cache
+}
+
+// lookupCachedSignature computes the weak cache key for a directory
+// container and returns it along with the cached hashes, if any. The
+// hashes are nil on a cache miss; the key is still returned so the
+// caller can Put into the cache once it has computed them itself.
+func lookupCachedSignature(sigCache *sigcache.Cache, basePath string, container *tlc.Container) (string, []wsync.BlockHash) {
+	paths := make([]string, len(container.Files))
+	for i, f := range container.Files {
+		paths[i] = filepath.Join(basePath, f.Path)
+	}
+
+	key, err := sigcache.ContainerKey(paths)
+	if err != nil {
+		comm.Debugf("sig-cache: could not compute key: %s", err.Error())
+		return "", nil
+	}
+
+	cached, ok := sigCache.Get(key)
+	if !ok {
+		return key, nil
+	}
+
+	return key, cached.Hashes
+}
+
+// isRemoteURL returns whether target is addressed by scheme rather than
+// by local filesystem path, e.g. `http://`, `https://` or `itchfs://`.
+// Every such scheme goes through eos.Open, not just http(s), so the
+// sig-cache's HEAD-before-GET short-circuit should too.
+func isRemoteURL(target string) bool {
+	return strings.Contains(target, "://")
+}
+
+// remoteCacheKey derives a cache key for a remote target from the
+// os.FileInfo eos.Open's Stat() returns: the backing storage's ETag, if
+// it exposes one, or its size and modification time otherwise.
+func remoteCacheKey(target string, stats os.FileInfo) string {
+	if tagged, ok := stats.(interface{ ETag() string }); ok {
+		if etag := tagged.ETag(); etag != "" {
+			return fmt.Sprintf("eos:%s:etag:%s", target, etag)
+		}
+	}
+	return fmt.Sprintf("eos:%s:%d:%d", target, stats.Size(), stats.ModTime().UnixNano())
+}
+
+// lookupCachedRemoteSignature opens target through eos (issuing a HEAD
+// for http(s) and whatever metadata call the backing scheme uses
+// otherwise) without reading its body, and returns the cached signature
+// if one matches its current stat info.
+func lookupCachedRemoteSignature(sigCache *sigcache.Cache, target string) (*pwr.SignatureInfo, bool) {
+	reader, err := eos.Open(target, option.WithConsumer(comm.NewStateConsumer()))
+	if err != nil {
+		comm.Debugf("sig-cache: opening %s failed: %s", target, err.Error())
+		return nil, false
+	}
+	defer reader.Close()
+
+	stats, err := reader.Stat()
+	if err != nil || stats.IsDir() {
+		return nil, false
+	}
+
+	return sigCache.Get(remoteCacheKey(target, stats))
+}
+
+// storeCachedRemoteSignature stores sig under target's current stat
+// info (as obtained by the caller's own eos.Open call, so this doesn't
+// need to re-fetch it), so the next run against the same target can
+// skip streaming it entirely.
+func storeCachedRemoteSignature(sigCache *sigcache.Cache, target string, stats os.FileInfo, sig *pwr.SignatureInfo) {
+	if err := sigCache.Put(remoteCacheKey(target, stats), sig); err != nil {
+		comm.Debugf("sig-cache: could not store: %s", err.Error())
+	}
+}
+
 func Do(params *Params) error {
 	var err error
 
@@ -68,6 +193,21 @@ func Do(params *Params) error {
 
 	targetSignature := &pwr.SignatureInfo{}
 
+	jobs := params.Jobs
+	if jobs < 1 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	sigCache := openSigCache(params)
+	if sigCache != nil {
+		defer sigCache.Close()
+		go func() {
+			if err := sigCache.GC(30 * 24 * time.Hour); err != nil {
+				comm.Debugf("sig-cache: GC failed: %s", err.Error())
+			}
+		}()
+	}
+
 	if params.Target == "" {
 		return errors.New("diff: must specify Target")
 	}
@@ -106,29 +246,53 @@ func Do(params *Params) error {
 
 		comm.Opf("Read signature from %s", params.Target)
 
+		if sigCache != nil && isRemoteURL(params.Target) {
+			storeCachedRemoteSignature(sigCache, params.Target, stats, targetSignature)
+		}
+
 		return nil
 	}
 
-	err = readAsSignature()
+	haveTargetSignature := false
+	if sigCache != nil && isRemoteURL(params.Target) {
+		if cached, ok := lookupCachedRemoteSignature(sigCache, params.Target); ok {
+			targetSignature = cached
+			comm.Opf("Re-used cached signature for %s", params.Target)
+			haveTargetSignature = true
+		}
+	}
 
-	if err != nil {
+	if !haveTargetSignature {
+		err = readAsSignature()
+	}
+
+	if !haveTargetSignature && err != nil {
 		if errors.Cause(err) == wire.ErrFormat || errors.Cause(err) == io.EOF {
 			// must be a container then
 			targetSignature.Container, err = tlc.WalkAny(params.Target, &tlc.WalkOpts{Filter: filtering.FilterPaths})
 			// Container (dir, archive, etc.)
 			comm.Opf("Hashing %s", params.Target)
 
-			comm.StartProgress()
-			var targetPool wsync.Pool
-			targetPool, err = pools.New(targetSignature.Container, params.Target)
-			if err != nil {
-				return errors.Wrap(err, "opening target as directory")
+			var cacheKey string
+			if sigCache != nil {
+				cacheKey, targetSignature.Hashes = lookupCachedSignature(sigCache, params.Target, targetSignature.Container)
 			}
 
-			targetSignature.Hashes, err = pwr.ComputeSignature(context.Background(), targetSignature.Container, targetPool, comm.NewStateConsumer())
-			comm.EndProgress()
-			if err != nil {
-				return errors.Wrap(err, "computing target signature")
+			if targetSignature.Hashes == nil {
+				comm.StartProgress()
+				targetSignature.Hashes, err = computeSignatureParallel(context.Background(), targetSignature.Container, params.Target, jobs, comm.NewStateConsumer())
+				comm.EndProgress()
+				if err != nil {
+					return errors.Wrap(err, "computing target signature")
+				}
+
+				if sigCache != nil && cacheKey != "" {
+					if err := sigCache.Put(cacheKey, targetSignature); err != nil {
+						comm.Debugf("sig-cache: could not store: %s", err.Error())
+					}
+				}
+			} else {
+				comm.Opf("Re-used cached signature for %s", params.Target)
 			}
 
 			{
@@ -168,8 +332,54 @@ func Do(params *Params) error {
 	}
 	defer signatureWriter.Close()
 
-	patchCounter := counter.NewWriter(patchWriter)
-	signatureCounter := counter.NewWriter(signatureWriter)
+	verifyParallel := params.Verify && jobs > 1
+
+	var patchDest io.Writer = patchWriter
+	var sigDest io.Writer = signatureWriter
+	var patchPipeWriter *io.PipeWriter
+	var sigPipeWriter *io.PipeWriter
+	var vj *verifyJoin
+
+	if verifyParallel {
+		var patchPipeReader *io.PipeReader
+		var sigPipeReader *io.PipeReader
+		patchPipeReader, patchPipeWriter = io.Pipe()
+		sigPipeReader, sigPipeWriter = io.Pipe()
+		patchDest = io.MultiWriter(patchWriter, patchPipeWriter)
+		sigDest = io.MultiWriter(signatureWriter, sigPipeWriter)
+
+		// Start reading right away: these are unbuffered pipes, so the
+		// tee below would otherwise block on the first byte until this
+		// goroutine gets around to consuming it, serializing writing
+		// and verifying instead of overlapping them.
+		vj = startVerifyJoin(func() error {
+			signature, err := pwr.ReadSignature(context.Background(), newPipeSource(sigPipeReader))
+			if err != nil {
+				io.Copy(ioutil.Discard, patchPipeReader)
+				return errors.Wrap(err, "reading fresh signature for verify")
+			}
+
+			actx := &pwr.ApplyContext{
+				OutputPool: &pwr.ValidatingPool{
+					Pool:      nullpool.New(sourceContainer),
+					Container: sourceContainer,
+					Signature: signature,
+				},
+				TargetPath:      params.Target,
+				TargetContainer: targetSignature.Container,
+				SourceContainer: sourceContainer,
+				Consumer:        comm.NewStateConsumer(),
+			}
+
+			if err := actx.ApplyPatch(newPipeSource(patchPipeReader)); err != nil {
+				return errors.Wrap(err, "applying patch")
+			}
+			return nil
+		})
+	}
+
+	patchCounter := counter.NewWriter(patchDest)
+	signatureCounter := counter.NewWriter(sigDest)
 
 	dctx := &pwr.DiffContext{
 		SourceContainer: sourceContainer,
@@ -185,10 +395,15 @@ func Do(params *Params) error {
 	comm.Opf("Diffing %s", params.Source)
 	comm.StartProgress()
 	err = dctx.WritePatch(context.Background(), patchCounter, signatureCounter)
+	comm.EndProgress()
+	if verifyParallel {
+		patchPipeWriter.CloseWithError(err)
+		sigPipeWriter.CloseWithError(err)
+		err = vj.Finish(err)
+	}
 	if err != nil {
 		return errors.Wrap(err, "computing and writing patch and signature")
 	}
-	comm.EndProgress()
 
 	totalDuration := time.Since(startTime)
 	{
@@ -208,50 +423,56 @@ func Do(params *Params) error {
 	}
 
 	if params.Verify {
-		comm.Opf("Applying patch to verify it...")
-		_, err := signatureWriter.Seek(0, io.SeekStart)
-		if err != nil {
-			return errors.Wrap(err, "seeking to beginning of fresh signature file")
-		}
+		if verifyParallel {
+			// Already joined and checked above, right after WritePatch
+			// returned: the overlap is the whole point of the parallel
+			// path, so there's nothing left to wait for here.
+		} else {
+			comm.Opf("Applying patch to verify it...")
+			_, err := signatureWriter.Seek(0, io.SeekStart)
+			if err != nil {
+				return errors.Wrap(err, "seeking to beginning of fresh signature file")
+			}
 
-		signatureSource := seeksource.FromFile(signatureWriter)
+			signatureSource := seeksource.FromFile(signatureWriter)
 
-		_, err = signatureSource.Resume(nil)
-		if err != nil {
-			return errors.Wrap(err, "reading fresh signature file")
-		}
+			_, err = signatureSource.Resume(nil)
+			if err != nil {
+				return errors.Wrap(err, "reading fresh signature file")
+			}
 
-		signature, err := pwr.ReadSignature(context.Background(), signatureSource)
-		if err != nil {
-			return errors.Wrap(err, "decoding fresh signature file")
-		}
+			signature, err := pwr.ReadSignature(context.Background(), signatureSource)
+			if err != nil {
+				return errors.Wrap(err, "decoding fresh signature file")
+			}
 
-		actx := &pwr.ApplyContext{
-			OutputPool: &pwr.ValidatingPool{
-				Pool:      nullpool.New(sourceContainer),
-				Container: sourceContainer,
-				Signature: signature,
-			},
-			TargetPath:      params.Target,
-			TargetContainer: targetSignature.Container,
+			actx := &pwr.ApplyContext{
+				OutputPool: &pwr.ValidatingPool{
+					Pool:      nullpool.New(sourceContainer),
+					Container: sourceContainer,
+					Signature: signature,
+				},
+				TargetPath:      params.Target,
+				TargetContainer: targetSignature.Container,
 
-			SourceContainer: sourceContainer,
+				SourceContainer: sourceContainer,
 
-			Consumer: comm.NewStateConsumer(),
-		}
+				Consumer: comm.NewStateConsumer(),
+			}
 
-		patchSource := seeksource.FromFile(patchWriter)
+			patchSource := seeksource.FromFile(patchWriter)
 
-		_, err = patchSource.Resume(nil)
-		if err != nil {
-			return errors.Wrap(err, "creating source for patch")
-		}
+			_, err = patchSource.Resume(nil)
+			if err != nil {
+				return errors.Wrap(err, "creating source for patch")
+			}
 
-		comm.StartProgress()
-		err = actx.ApplyPatch(patchSource)
-		comm.EndProgress()
-		if err != nil {
-			return errors.Wrap(err, "applying patch")
+			comm.StartProgress()
+			err = actx.ApplyPatch(patchSource)
+			comm.EndProgress()
+			if err != nil {
+				return errors.Wrap(err, "applying patch")
+			}
 		}
 
 		comm.Statf("Patch applies cleanly!")
@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+
+	"github.com/itchio/savior"
+)
+
+// pipeSource adapts a plain forward-only io.Reader (the read end of an
+// io.Pipe, in practice) to savior.Source, so ApplyPatch can consume the
+// patch as it's being written instead of waiting for it to land on disk
+// and re-opening it from the start.
+type pipeSource struct {
+	reader *bufio.Reader
+	closer io.Closer
+	read   int64
+}
+
+var _ savior.Source = (*pipeSource)(nil)
+
+func newPipeSource(r *io.PipeReader) *pipeSource {
+	return &pipeSource{
+		reader: bufio.NewReaderSize(r, 256*1024),
+		closer: r,
+	}
+}
+
+// Resume only supports starting from the beginning: the underlying pipe
+// has no way to seek back, which is fine for a one-shot verify pass.
+func (ps *pipeSource) Resume(checkpoint *savior.SourceCheckpoint) (int64, error) {
+	if checkpoint != nil && checkpoint.Offset != 0 {
+		return 0, savior.ErrUnsupportedResume
+	}
+	return 0, nil
+}
+
+func (ps *pipeSource) Read(buf []byte) (int, error) {
+	n, err := ps.reader.Read(buf)
+	ps.read += int64(n)
+	return n, err
+}
+
+func (ps *pipeSource) ReadByte() (byte, error) {
+	b, err := ps.reader.ReadByte()
+	if err == nil {
+		ps.read++
+	}
+	return b, err
+}
+
+func (ps *pipeSource) Discard(n int64) (int64, error) {
+	discarded, err := io.CopyN(ioutil.Discard, ps.reader, n)
+	ps.read += discarded
+	return discarded, err
+}
+
+func (ps *pipeSource) Close() error {
+	return ps.closer.Close()
+}
+
+// Progress can't be known precisely since the total patch size isn't
+// final until writing completes; callers only use it for display.
+func (ps *pipeSource) Progress() float64 {
+	return -1
+}
+
+func (ps *pipeSource) Features() savior.SourceFeatures {
+	return savior.SourceFeatures{
+		ResumeSupport: savior.ResumeSupportNone,
+	}
+}
+
+func (ps *pipeSource) SetSourceSaveConsumer(ssc savior.SourceSaveConsumer) {
+	// no-op: a forward-only pipe can't produce save points
+}
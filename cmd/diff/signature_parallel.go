@@ -0,0 +1,195 @@
+package diff
+
+import (
+	"context"
+	"sync"
+
+	"github.com/itchio/wharf/pools"
+	"github.com/itchio/wharf/pwr"
+	"github.com/itchio/wharf/state"
+	"github.com/itchio/wharf/tlc"
+	"github.com/itchio/wharf/wsync"
+)
+
+// computeSignatureParallel computes a container's signature the same
+// way pwr.ComputeSignature does, but spreads the work over up to jobs
+// goroutines, each hashing a contiguous shard of the file list through
+// its own pool. Shards are concatenated back in container order, so the
+// result is identical to what a single serial call would have produced.
+func computeSignatureParallel(ctx context.Context, container *tlc.Container, basePath string, jobs int, consumer *state.Consumer) ([]wsync.BlockHash, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(container.Files) {
+		jobs = len(container.Files)
+	}
+	if jobs <= 1 {
+		pool, err := pools.New(container, basePath)
+		if err != nil {
+			return nil, err
+		}
+		return pwr.ComputeSignature(ctx, container, pool, consumer)
+	}
+
+	shards := shardContainer(container, jobs)
+	results := make([][]wsync.BlockHash, len(shards))
+	errs := make([]error, len(shards))
+
+	progress := newAggregateProgress(consumer, shards)
+
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard *tlc.Container) {
+			defer wg.Done()
+
+			pool, err := pools.New(shard, basePath)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			hashes, err := pwr.ComputeSignature(ctx, shard, pool, progress.consumerFor(i))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = hashes
+		}(i, shard)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// each shard numbers its files from zero, so shift FileIndex by the
+	// number of files in the shards before it
+	var merged []wsync.BlockHash
+	var fileOffset int64
+	for i, hashes := range results {
+		for _, hash := range hashes {
+			hash.FileIndex += fileOffset
+			merged = append(merged, hash)
+		}
+		fileOffset += int64(len(shards[i].Files))
+	}
+	return merged, nil
+}
+
+// aggregateProgress fans the fractional progress reported by each
+// shard's own *state.Consumer back into a single running total on the
+// real consumer. state.Consumer isn't safe for concurrent callbacks, so
+// every worker must report through its own wrapper instead of sharing
+// one consumer, and the aggregation itself needs a mutex since several
+// workers can report at the same instant.
+type aggregateProgress struct {
+	consumer *state.Consumer
+	weights  []float64
+
+	mutex    sync.Mutex
+	progress []float64
+}
+
+func newAggregateProgress(consumer *state.Consumer, shards []*tlc.Container) *aggregateProgress {
+	var total int64
+	for _, shard := range shards {
+		total += shard.Size
+	}
+
+	weights := make([]float64, len(shards))
+	for i, shard := range shards {
+		if total > 0 {
+			weights[i] = float64(shard.Size) / float64(total)
+		} else {
+			weights[i] = 1.0 / float64(len(shards))
+		}
+	}
+
+	return &aggregateProgress{
+		consumer: consumer,
+		weights:  weights,
+		progress: make([]float64, len(shards)),
+	}
+}
+
+// consumerFor returns the *state.Consumer worker i should use. Every
+// callback it forwards to the real consumer — not just OnProgress — is
+// made under ap's mutex, since state.Consumer isn't safe for concurrent
+// calls and OnMessage is just as reachable from multiple workers as
+// OnProgress is.
+func (ap *aggregateProgress) consumerFor(i int) *state.Consumer {
+	if ap.consumer == nil {
+		return nil
+	}
+
+	return &state.Consumer{
+		OnMessage: func(level string, message string) {
+			ap.mutex.Lock()
+			defer ap.mutex.Unlock()
+			if ap.consumer.OnMessage != nil {
+				ap.consumer.OnMessage(level, message)
+			}
+		},
+		OnProgress: func(p float64) {
+			ap.mutex.Lock()
+			defer ap.mutex.Unlock()
+
+			ap.progress[i] = p
+			var total float64
+			for j, weight := range ap.weights {
+				total += ap.progress[j] * weight
+			}
+
+			if ap.consumer.OnProgress != nil {
+				ap.consumer.OnProgress(total)
+			}
+		},
+	}
+}
+
+// shardContainer splits container's file list into up to n contiguous,
+// roughly byte-equal sub-containers, preserving file order, so that
+// concatenating their signatures in shard order reconstructs the same
+// ordering a serial ComputeSignature call would have produced.
+func shardContainer(container *tlc.Container, n int) []*tlc.Container {
+	if n <= 1 || len(container.Files) <= 1 {
+		return []*tlc.Container{container}
+	}
+
+	targetShardSize := container.Size / int64(n)
+	if targetShardSize <= 0 {
+		targetShardSize = 1
+	}
+
+	var shards []*tlc.Container
+	var current []tlc.File
+	var currentSize int64
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		shards = append(shards, &tlc.Container{
+			Dirs:     container.Dirs,
+			Symlinks: container.Symlinks,
+			Files:    current,
+			Size:     currentSize,
+		})
+		current = nil
+		currentSize = 0
+	}
+
+	for _, f := range container.Files {
+		current = append(current, f)
+		currentSize += f.Size
+		if currentSize >= targetShardSize && len(shards) < n-1 {
+			flush()
+		}
+	}
+	flush()
+
+	return shards
+}
@@ -0,0 +1,145 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/itchio/wharf/state"
+	"github.com/itchio/wharf/tlc"
+)
+
+func containerWithFileSizes(sizes ...int64) *tlc.Container {
+	var total int64
+	files := make([]tlc.File, len(sizes))
+	for i, size := range sizes {
+		files[i] = tlc.File{Path: string(rune('a' + i)), Size: size}
+		total += size
+	}
+	return &tlc.Container{Files: files, Size: total}
+}
+
+func shardSizes(shards []*tlc.Container) []int64 {
+	sizes := make([]int64, len(shards))
+	for i, shard := range shards {
+		sizes[i] = shard.Size
+	}
+	return sizes
+}
+
+func shardFileCount(shards []*tlc.Container) int {
+	count := 0
+	for _, shard := range shards {
+		count += len(shard.Files)
+	}
+	return count
+}
+
+func TestShardContainerSingleJobReturnsWholeContainer(t *testing.T) {
+	container := containerWithFileSizes(10, 20, 30)
+	shards := shardContainer(container, 1)
+	if len(shards) != 1 {
+		t.Fatalf("expected 1 shard, got %d", len(shards))
+	}
+	if shards[0] != container {
+		t.Fatalf("expected the single shard to be the original container")
+	}
+}
+
+func TestShardContainerSingleFileReturnsWholeContainer(t *testing.T) {
+	container := containerWithFileSizes(10)
+	shards := shardContainer(container, 4)
+	if len(shards) != 1 {
+		t.Fatalf("expected 1 shard for a single-file container, got %d", len(shards))
+	}
+}
+
+func TestShardContainerPreservesAllFiles(t *testing.T) {
+	container := containerWithFileSizes(10, 20, 30, 40, 50)
+	shards := shardContainer(container, 3)
+
+	if got := shardFileCount(shards); got != len(container.Files) {
+		t.Fatalf("expected shards to cover all %d files, got %d", len(container.Files), got)
+	}
+
+	var total int64
+	for _, size := range shardSizes(shards) {
+		total += size
+	}
+	if total != container.Size {
+		t.Fatalf("expected shard sizes to sum to container size %d, got %d", container.Size, total)
+	}
+}
+
+func TestShardContainerNeverExceedsRequestedCount(t *testing.T) {
+	container := containerWithFileSizes(1, 1, 1, 1, 1, 1, 1, 1, 1, 1)
+	for _, n := range []int{1, 2, 3, 5, 10, 20} {
+		shards := shardContainer(container, n)
+		if len(shards) > n {
+			t.Fatalf("shardContainer(container, %d) returned %d shards", n, len(shards))
+		}
+		if len(shards) > len(container.Files) {
+			t.Fatalf("shardContainer(container, %d) returned more shards than files", n)
+		}
+	}
+}
+
+func TestShardContainerPreservesFileOrder(t *testing.T) {
+	container := containerWithFileSizes(10, 20, 30, 40, 50)
+	shards := shardContainer(container, 3)
+
+	var gotOrder []string
+	for _, shard := range shards {
+		for _, f := range shard.Files {
+			gotOrder = append(gotOrder, f.Path)
+		}
+	}
+
+	for i, f := range container.Files {
+		if gotOrder[i] != f.Path {
+			t.Fatalf("expected shard concatenation to preserve file order, got %v", gotOrder)
+		}
+	}
+}
+
+func TestAggregateProgressWeightsByShardSize(t *testing.T) {
+	shards := []*tlc.Container{
+		{Size: 10},
+		{Size: 30},
+	}
+
+	var reported []float64
+	consumer := &state.Consumer{
+		OnProgress: func(p float64) {
+			reported = append(reported, p)
+		},
+	}
+
+	ap := newAggregateProgress(consumer, shards)
+
+	// the small shard finishing alone should only move the total by its
+	// 25% weight, not all the way to 100%
+	ap.consumerFor(0).OnProgress(1.0)
+	if len(reported) != 1 {
+		t.Fatalf("expected one progress report, got %d", len(reported))
+	}
+	if got := reported[0]; got < 0.24 || got > 0.26 {
+		t.Fatalf("expected ~0.25 after the small shard finished, got %f", got)
+	}
+
+	ap.consumerFor(1).OnProgress(1.0)
+	if got := reported[1]; got < 0.99 || got > 1.01 {
+		t.Fatalf("expected ~1.0 once both shards finished, got %f", got)
+	}
+}
+
+func TestShardContainerLumpyTailDoesNotOverflowShardCount(t *testing.T) {
+	// one huge file followed by many tiny ones: naive byte-threshold
+	// sharding could otherwise keep starting new shards for the tail
+	container := containerWithFileSizes(1000, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1)
+	shards := shardContainer(container, 4)
+	if len(shards) > 4 {
+		t.Fatalf("expected at most 4 shards, got %d", len(shards))
+	}
+	if got := shardFileCount(shards); got != len(container.Files) {
+		t.Fatalf("expected shards to cover all %d files, got %d", len(container.Files), got)
+	}
+}
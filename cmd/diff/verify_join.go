@@ -0,0 +1,37 @@
+package diff
+
+import "sync"
+
+// verifyJoin tracks the background goroutine that applies the patch
+// being streamed out (for --verify's parallel path) and guarantees it's
+// always waited on, no matter which way the caller returns. It exists
+// because forgetting that Wait on an error return is exactly the
+// goroutine leak this type replaces.
+type verifyJoin struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// startVerifyJoin runs fn in a goroutine and returns a verifyJoin
+// tracking it. fn's error (if any) is reported once Finish is called.
+func startVerifyJoin(fn func() error) *verifyJoin {
+	vj := &verifyJoin{}
+	vj.wg.Add(1)
+	go func() {
+		defer vj.wg.Done()
+		vj.err = fn()
+	}()
+	return vj
+}
+
+// Finish waits for the verify goroutine to return, then folds its
+// error into writeErr: writeErr (the error from the code that was
+// producing what verify consumed) takes precedence, since it's usually
+// the root cause of any failure the verify side also observed.
+func (vj *verifyJoin) Finish(writeErr error) error {
+	vj.wg.Wait()
+	if writeErr != nil {
+		return writeErr
+	}
+	return vj.err
+}
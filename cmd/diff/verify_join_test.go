@@ -0,0 +1,51 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyJoinFinishWaitsForGoroutine(t *testing.T) {
+	done := make(chan struct{})
+	vj := startVerifyJoin(func() error {
+		close(done)
+		return nil
+	})
+
+	if err := vj.Finish(nil); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	select {
+	case <-done:
+	default:
+		t.Fatalf("expected fn to have run before Finish returned")
+	}
+}
+
+func TestVerifyJoinFinishAlwaysWaitsEvenOnWriteErr(t *testing.T) {
+	ran := false
+	vj := startVerifyJoin(func() error {
+		ran = true
+		return nil
+	})
+
+	writeErr := errors.New("write failed")
+	if err := vj.Finish(writeErr); err != writeErr {
+		t.Fatalf("expected write error to take precedence, got %v", err)
+	}
+	if !ran {
+		t.Fatalf("expected fn to have been waited on even though writeErr was non-nil")
+	}
+}
+
+func TestVerifyJoinFinishReportsFnErrWhenWriteSucceeded(t *testing.T) {
+	fnErr := errors.New("verify failed")
+	vj := startVerifyJoin(func() error {
+		return fnErr
+	})
+
+	if err := vj.Finish(nil); err != fnErr {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package launch
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/itchio/butler/comm"
+	"github.com/itchio/butler/mansion"
+	"github.com/itchio/butler/runner"
+)
+
+var args = struct {
+	command            *string
+	cpuPercent         *int
+	jobMemoryMB        *int
+	processMemoryMB    *int
+	maxActiveProcesses *int
+	disableClipboard   *bool
+}{}
+
+func Register(ctx *mansion.Context) {
+	cmd := ctx.App.Command("launch", "(Advanced) Run a game under a sandboxed job object, enforcing resource limits and reporting peak usage once it exits")
+	args.command = cmd.Arg("command", "Full command line to launch, e.g. `C:\\Games\\foo\\foo.exe --windowed`").Required().String()
+	args.cpuPercent = cmd.Flag("cpu-percent", "Maximum share of CPU time the game may use, e.g. 50 for 50%").Int()
+	args.jobMemoryMB = cmd.Flag("job-memory-mb", "Maximum committed memory in MB for the whole process tree").Int()
+	args.processMemoryMB = cmd.Flag("process-memory-mb", "Maximum committed memory in MB for any single process").Int()
+	args.maxActiveProcesses = cmd.Flag("max-processes", "Maximum number of processes alive at once in the process tree").Int()
+	args.disableClipboard = cmd.Flag("disable-clipboard", "Prevent the game from writing to the clipboard").Bool()
+	ctx.Register(cmd, do)
+}
+
+func do(ctx *mansion.Context) {
+	ctx.Must(Do(&Params{
+		Command: *args.command,
+		Limits: runner.SandboxLimits{
+			CPUPercent:            *args.cpuPercent,
+			JobMemoryBytes:        uint64(*args.jobMemoryMB) * 1024 * 1024,
+			ProcessMemoryBytes:    uint64(*args.processMemoryMB) * 1024 * 1024,
+			MaxActiveProcesses:    uint32(*args.maxActiveProcesses),
+			DisableClipboardWrite: *args.disableClipboard,
+		},
+	}))
+}
+
+type Params struct {
+	// Command is the full command line of the game to launch.
+	Command string
+	// Limits are the resource caps to enforce on the game's job object.
+	Limits runner.SandboxLimits
+}
+
+// Do launches params.Command under a sandboxed job object enforcing
+// params.Limits, waits for it to exit, then reports the job's peak
+// memory and IO counters — the status information QuerySandboxStats
+// exists to provide.
+func Do(params *Params) error {
+	comm.Opf("Launching %s (sandboxed)", params.Command)
+
+	process, sandbox, err := runner.Launch(params.Command, params.Limits)
+	if err != nil {
+		return fmt.Errorf("launching: %w", err)
+	}
+	defer sandbox.Close()
+	defer syscall.CloseHandle(process)
+
+	if _, err := syscall.WaitForSingleObject(process, syscall.INFINITE); err != nil {
+		return fmt.Errorf("waiting for process: %w", err)
+	}
+
+	stats, err := sandbox.Stats()
+	if err != nil {
+		return fmt.Errorf("querying sandbox stats: %w", err)
+	}
+
+	comm.Statf("Peak process memory: %d bytes, peak job memory: %d bytes", stats.PeakProcessMemoryUsed, stats.PeakJobMemoryUsed)
+	comm.Statf("IO: %d reads, %d writes, %d other", stats.IoCounters.ReadOperationCount, stats.IoCounters.WriteOperationCount, stats.IoCounters.OtherOperationCount)
+
+	return nil
+}
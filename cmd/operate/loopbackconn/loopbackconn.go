@@ -3,6 +3,8 @@ package loopbackconn
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/itchio/butler/butlerd"
 
@@ -14,6 +16,19 @@ import (
 type NotificationHandler func(ctx context.Context, method string, params interface{}) error
 type CallHandler func(ctx context.Context, method string, params interface{}, result interface{}) error
 
+// Middleware wraps a CallHandler with cross-cutting behavior (tracing,
+// metrics, ...) without every registration having to do it itself.
+type Middleware func(next CallHandler) CallHandler
+
+// Yield is handed to a StreamHandler so it can emit intermediate values,
+// the same way a real butlerd call emits progress notifications while
+// it's in flight (see Game.Install).
+type Yield func(v interface{}) error
+
+// StreamHandler is like a CallHandler, but may call yield any number of
+// times before returning.
+type StreamHandler func(ctx context.Context, method string, params interface{}, yield Yield) error
+
 var NoopNotificationHandler NotificationHandler = func(ctx context.Context, method string, params interface{}) error {
 	return nil
 }
@@ -23,12 +38,40 @@ type LoopbackConn interface {
 
 	OnNotification(method string, handler NotificationHandler)
 	OnCall(method string, handler CallHandler)
+
+	// OnStream registers a handler for Stream calls to method.
+	OnStream(method string, handler StreamHandler)
+	// Stream invokes the StreamHandler registered for method and
+	// returns a channel of the values it yields, closed once the
+	// handler returns.
+	Stream(ctx context.Context, method string, params interface{}) (<-chan interface{}, error)
+
+	// Intercept adds mw to the middleware chain wrapping every OnCall
+	// handler, in registration order (the first added is outermost).
+	Intercept(mw Middleware)
+
+	// CancelCall cancels the context of the in-flight call identified
+	// by requestID (see WithRequestID), if any. Returns whether a
+	// matching in-flight call was found.
+	CancelCall(requestID int64) bool
+
+	// Fallthrough sets conn as the target for methods with no
+	// registered handler, instead of erroring out. Useful for tests
+	// that mix mocked and real endpoints.
+	Fallthrough(conn butlerd.Conn)
 }
 
 type loopbackConn struct {
 	consumer             *state.Consumer
 	notificationHandlers map[string]NotificationHandler
 	callHandlers         map[string]CallHandler
+	streamHandlers       map[string]StreamHandler
+	middlewares          []Middleware
+	fallthroughConn      butlerd.Conn
+
+	callsMutex sync.Mutex
+	calls      map[int64]context.CancelFunc
+	nextCallID int64
 }
 
 func New(consumer *state.Consumer) LoopbackConn {
@@ -36,6 +79,8 @@ func New(consumer *state.Consumer) LoopbackConn {
 		consumer:             consumer,
 		notificationHandlers: make(map[string]NotificationHandler),
 		callHandlers:         make(map[string]CallHandler),
+		streamHandlers:       make(map[string]StreamHandler),
+		calls:                make(map[int64]context.CancelFunc),
 	}
 
 	lc.OnNotification("Log", func(ctx context.Context, method string, params interface{}) error {
@@ -57,6 +102,9 @@ func (lc *loopbackConn) Notify(ctx context.Context, method string, params interf
 	if h, ok := lc.notificationHandlers[method]; ok {
 		return h(ctx, method, params)
 	}
+	if lc.fallthroughConn != nil {
+		return lc.fallthroughConn.Notify(ctx, method, params)
+	}
 	return nil
 }
 
@@ -64,11 +112,104 @@ func (lc *loopbackConn) OnCall(method string, handler CallHandler) {
 	lc.callHandlers[method] = handler
 }
 
+func (lc *loopbackConn) OnStream(method string, handler StreamHandler) {
+	lc.streamHandlers[method] = handler
+}
+
+func (lc *loopbackConn) Intercept(mw Middleware) {
+	lc.middlewares = append(lc.middlewares, mw)
+}
+
+func (lc *loopbackConn) Fallthrough(conn butlerd.Conn) {
+	lc.fallthroughConn = conn
+}
+
+type requestIDKey struct{}
+
+// WithRequestID attaches a caller-chosen request ID to ctx, so that a
+// later CancelCall(requestID) can cancel this specific call while it's
+// in flight.
+func WithRequestID(ctx context.Context, requestID int64) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
 func (lc *loopbackConn) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
-	if h, ok := lc.callHandlers[method]; ok {
-		return h(ctx, method, params, result)
+	h, ok := lc.callHandlers[method]
+	if !ok {
+		if lc.fallthroughConn != nil {
+			return lc.fallthroughConn.Call(ctx, method, params, result)
+		}
+		return fmt.Errorf("No handler registered for method (%s)", method)
+	}
+
+	for i := len(lc.middlewares) - 1; i >= 0; i-- {
+		h = lc.middlewares[i](h)
+	}
+
+	requestID, ok := ctx.Value(requestIDKey{}).(int64)
+	if !ok {
+		requestID = atomic.AddInt64(&lc.nextCallID, 1)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	lc.registerCall(requestID, cancel)
+	defer lc.unregisterCall(requestID)
+
+	return h(ctx, method, params, result)
+}
+
+// Stream invokes the StreamHandler registered for method, returning a
+// channel fed by its yield calls. The channel is closed once the
+// handler returns, regardless of whether it returned an error.
+func (lc *loopbackConn) Stream(ctx context.Context, method string, params interface{}) (<-chan interface{}, error) {
+	h, ok := lc.streamHandlers[method]
+	if !ok {
+		return nil, fmt.Errorf("No stream handler registered for method (%s)", method)
+	}
+
+	out := make(chan interface{})
+
+	yield := func(v interface{}) error {
+		select {
+		case out <- v:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(out)
+		if err := h(ctx, method, params, yield); err != nil {
+			lc.consumer.OnMessage("error", fmt.Sprintf("stream %s: %s", method, err.Error()))
+		}
+	}()
+
+	return out, nil
+}
+
+func (lc *loopbackConn) registerCall(requestID int64, cancel context.CancelFunc) {
+	lc.callsMutex.Lock()
+	defer lc.callsMutex.Unlock()
+	lc.calls[requestID] = cancel
+}
+
+func (lc *loopbackConn) unregisterCall(requestID int64) {
+	lc.callsMutex.Lock()
+	defer lc.callsMutex.Unlock()
+	delete(lc.calls, requestID)
+}
+
+func (lc *loopbackConn) CancelCall(requestID int64) bool {
+	lc.callsMutex.Lock()
+	cancel, ok := lc.calls[requestID]
+	lc.callsMutex.Unlock()
+
+	if !ok {
+		return false
 	}
-	return fmt.Errorf("No handler registered for method (%s)", method)
+	cancel()
+	return true
 }
 
 func (lc *loopbackConn) Close() error {
@@ -0,0 +1,242 @@
+package loopbackconn
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/itchio/wharf/state"
+)
+
+func newTestConsumer(t *testing.T) *state.Consumer {
+	return &state.Consumer{
+		OnMessage: func(level string, message string) {
+			t.Logf("[%s] %s", level, message)
+		},
+	}
+}
+
+func TestCallDispatchesToRegisteredHandler(t *testing.T) {
+	lc := New(newTestConsumer(t))
+
+	called := false
+	lc.OnCall("Game.Install", func(ctx context.Context, method string, params interface{}, result interface{}) error {
+		called = true
+		return nil
+	})
+
+	if err := lc.Call(context.Background(), "Game.Install", nil, nil); err != nil {
+		t.Fatalf("Call: %s", err.Error())
+	}
+	if !called {
+		t.Fatalf("expected the registered handler to be invoked")
+	}
+}
+
+func TestCallWithNoHandlerAndNoFallthroughErrors(t *testing.T) {
+	lc := New(newTestConsumer(t))
+
+	if err := lc.Call(context.Background(), "Unknown.Method", nil, nil); err == nil {
+		t.Fatalf("expected an error when no handler and no fallthrough are set")
+	}
+}
+
+func TestInterceptWrapsInRegistrationOrder(t *testing.T) {
+	lc := New(newTestConsumer(t))
+
+	var order []string
+	lc.OnCall("Game.Install", func(ctx context.Context, method string, params interface{}, result interface{}) error {
+		order = append(order, "handler")
+		return nil
+	})
+	lc.Intercept(func(next CallHandler) CallHandler {
+		return func(ctx context.Context, method string, params interface{}, result interface{}) error {
+			order = append(order, "outer-before")
+			err := next(ctx, method, params, result)
+			order = append(order, "outer-after")
+			return err
+		}
+	})
+	lc.Intercept(func(next CallHandler) CallHandler {
+		return func(ctx context.Context, method string, params interface{}, result interface{}) error {
+			order = append(order, "inner-before")
+			err := next(ctx, method, params, result)
+			order = append(order, "inner-after")
+			return err
+		}
+	})
+
+	if err := lc.Call(context.Background(), "Game.Install", nil, nil); err != nil {
+		t.Fatalf("Call: %s", err.Error())
+	}
+
+	want := []string{"outer-before", "inner-before", "handler", "inner-after", "outer-after"}
+	if len(order) != len(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+}
+
+func TestCancelCallCancelsInFlightContext(t *testing.T) {
+	lc := New(newTestConsumer(t))
+
+	started := make(chan struct{})
+	var sawErr error
+	lc.OnCall("Game.Install", func(ctx context.Context, method string, params interface{}, result interface{}) error {
+		close(started)
+		<-ctx.Done()
+		sawErr = ctx.Err()
+		return ctx.Err()
+	})
+
+	const requestID = int64(42)
+	ctx := WithRequestID(context.Background(), requestID)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lc.Call(ctx, "Game.Install", nil, nil)
+	}()
+
+	<-started
+	if !lc.CancelCall(requestID) {
+		t.Fatalf("expected CancelCall to find the in-flight call")
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected the cancelled call to return an error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for the cancelled call to return")
+	}
+
+	if sawErr != context.Canceled {
+		t.Fatalf("expected the handler to observe context.Canceled, got %v", sawErr)
+	}
+
+	// once the call has returned, it's no longer tracked
+	if lc.CancelCall(requestID) {
+		t.Fatalf("expected CancelCall to report no in-flight call after completion")
+	}
+}
+
+func TestStreamYieldsUntilHandlerReturns(t *testing.T) {
+	lc := New(newTestConsumer(t))
+
+	lc.OnStream("Game.Download", func(ctx context.Context, method string, params interface{}, yield Yield) error {
+		for i := 0; i < 3; i++ {
+			if err := yield(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	out, err := lc.Stream(context.Background(), "Game.Download", nil)
+	if err != nil {
+		t.Fatalf("Stream: %s", err.Error())
+	}
+
+	var got []interface{}
+	for v := range out {
+		got = append(got, v)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 yielded values, got %d", len(got))
+	}
+}
+
+func TestStreamWithNoHandlerErrors(t *testing.T) {
+	lc := New(newTestConsumer(t))
+
+	if _, err := lc.Stream(context.Background(), "Unknown.Stream", nil); err == nil {
+		t.Fatalf("expected an error when no stream handler is registered")
+	}
+}
+
+type fakeConn struct {
+	notified bool
+	called   bool
+}
+
+func (fc *fakeConn) Notify(ctx context.Context, method string, params interface{}) error {
+	fc.notified = true
+	return nil
+}
+
+func (fc *fakeConn) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	fc.called = true
+	return nil
+}
+
+func (fc *fakeConn) Close() error {
+	return nil
+}
+
+func TestFallthroughUsedWhenNoHandlerRegistered(t *testing.T) {
+	lc := New(newTestConsumer(t))
+	fallback := &fakeConn{}
+	lc.Fallthrough(fallback)
+
+	if err := lc.Call(context.Background(), "Unmocked.Method", nil, nil); err != nil {
+		t.Fatalf("Call: %s", err.Error())
+	}
+	if !fallback.called {
+		t.Fatalf("expected the fallthrough conn's Call to be invoked")
+	}
+
+	if err := lc.Notify(context.Background(), "Unmocked.Notification", nil); err != nil {
+		t.Fatalf("Notify: %s", err.Error())
+	}
+	if !fallback.notified {
+		t.Fatalf("expected the fallthrough conn's Notify to be invoked")
+	}
+}
+
+func TestFallthroughNotUsedWhenHandlerRegistered(t *testing.T) {
+	lc := New(newTestConsumer(t))
+	fallback := &fakeConn{}
+	lc.Fallthrough(fallback)
+
+	lc.OnCall("Game.Install", func(ctx context.Context, method string, params interface{}, result interface{}) error {
+		return nil
+	})
+
+	if err := lc.Call(context.Background(), "Game.Install", nil, nil); err != nil {
+		t.Fatalf("Call: %s", err.Error())
+	}
+	if fallback.called {
+		t.Fatalf("expected the registered handler to take precedence over the fallthrough conn")
+	}
+}
+
+func TestStreamDeliversValuesYieldedBeforeHandlerError(t *testing.T) {
+	lc := New(newTestConsumer(t))
+
+	lc.OnStream("Game.Download", func(ctx context.Context, method string, params interface{}, yield Yield) error {
+		if err := yield("one"); err != nil {
+			return err
+		}
+		return fmt.Errorf("disk full")
+	})
+
+	out, err := lc.Stream(context.Background(), "Game.Download", nil)
+	if err != nil {
+		t.Fatalf("Stream: %s", err.Error())
+	}
+
+	var got []interface{}
+	for v := range out {
+		got = append(got, v)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected the one value yielded before the error, got %d", len(got))
+	}
+}
@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/itchio/butler/runner/syscallex"
+)
+
+// Launch starts commandLine under a freshly created
+// sandboxed job object enforcing limits, the same way `butler launch`
+// runs a game: the process is created suspended, assigned to the job,
+// then resumed, so it's caught by limits from its very first
+// instruction. Callers are responsible for waiting on the returned
+// process handle and eventually closing it, and for calling
+// Sandbox.Close once the game has exited.
+func Launch(commandLine string, limits SandboxLimits) (syscall.Handle, *Sandbox, error) {
+	cmdLine, err := syscall.UTF16PtrFromString(commandLine)
+	if err != nil {
+		return 0, nil, fmt.Errorf("encoding command line: %w", err)
+	}
+
+	var startupInfo syscall.StartupInfo
+	var procInfo syscall.ProcessInformation
+
+	err = syscall.CreateProcess(
+		nil,
+		cmdLine,
+		nil,
+		nil,
+		false,
+		syscallex.CREATE_SUSPENDED,
+		nil,
+		nil,
+		&startupInfo,
+		&procInfo,
+	)
+	if err != nil {
+		return 0, nil, fmt.Errorf("creating process: %w", err)
+	}
+	defer syscall.CloseHandle(procInfo.Thread)
+
+	sandbox, err := NewSandbox(procInfo.Process, limits)
+	if err != nil {
+		syscall.TerminateProcess(procInfo.Process, 1)
+		syscall.CloseHandle(procInfo.Process)
+		return 0, nil, fmt.Errorf("sandboxing process: %w", err)
+	}
+
+	if _, err := syscallex.ResumeThread(procInfo.Thread); err != nil {
+		sandbox.Close()
+		syscall.TerminateProcess(procInfo.Process, 1)
+		syscall.CloseHandle(procInfo.Process)
+		return 0, nil, fmt.Errorf("resuming process: %w", err)
+	}
+
+	return procInfo.Process, sandbox, nil
+}
@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/itchio/butler/runner/syscallex"
+)
+
+// Sandbox owns a Windows job object enforcing SandboxLimits on a game
+// process and everything it spawns. Closing the Sandbox kills the
+// entire job, the same way closing the handle of a job created with
+// JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE does.
+type Sandbox struct {
+	jobObject syscall.Handle
+}
+
+// NewSandbox creates a job object enforcing limits and assigns process
+// to it. process must not have been allowed to run any code yet (it
+// should be created suspended), since Windows won't let a process be
+// assigned to a job once it's already spawned a child of its own.
+func NewSandbox(process syscall.Handle, limits SandboxLimits) (*Sandbox, error) {
+	jobObject, err := syscallex.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating job object: %w", err)
+	}
+
+	killOnClose := syscallex.JobObjectBasicLimitInformation{
+		LimitFlags: syscallex.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+	}
+	err = syscallex.SetInformationJobObject(
+		jobObject,
+		syscallex.JobObjectInfoClass_JobObjectBasicLimitInformation,
+		uintptr(unsafe.Pointer(&killOnClose)),
+		unsafe.Sizeof(killOnClose),
+	)
+	if err != nil {
+		syscall.CloseHandle(jobObject)
+		return nil, fmt.Errorf("setting kill-on-close: %w", err)
+	}
+
+	if err := ApplySandboxLimits(jobObject, limits); err != nil {
+		syscall.CloseHandle(jobObject)
+		return nil, err
+	}
+
+	if err := syscallex.AssignProcessToJobObject(jobObject, process); err != nil {
+		syscall.CloseHandle(jobObject)
+		return nil, fmt.Errorf("assigning process to job object: %w", err)
+	}
+
+	return &Sandbox{jobObject: jobObject}, nil
+}
+
+// Stats reports the sandboxed process tree's peak memory and IO
+// counters so far, which `butler launch` displays once the game exits.
+func (s *Sandbox) Stats() (*JobObjectStats, error) {
+	return QuerySandboxStats(s.jobObject)
+}
+
+// Close terminates every process still running in the job (per
+// JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE) and releases the job object
+// handle.
+func (s *Sandbox) Close() error {
+	return syscall.CloseHandle(s.jobObject)
+}
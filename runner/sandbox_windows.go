@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/itchio/butler/runner/syscallex"
+)
+
+// SandboxLimits describes the resource caps to enforce on a game process
+// (and all its children) via a Windows job object.
+type SandboxLimits struct {
+	// CPUPercent is the maximum share of CPU time the job may use,
+	// e.g. 50 for 50%. Zero means no CPU limit.
+	CPUPercent int
+	// JobMemoryBytes is the maximum committed memory for the whole job
+	// (every process in it, combined). Zero means no job-wide limit.
+	JobMemoryBytes uint64
+	// ProcessMemoryBytes is the maximum committed memory for any single
+	// process in the job. Zero means no per-process limit.
+	ProcessMemoryBytes uint64
+	// DisableClipboardWrite prevents processes in the job from writing
+	// to the clipboard.
+	DisableClipboardWrite bool
+	// MaxActiveProcesses caps the number of processes alive in the job
+	// at once. Zero means no limit.
+	MaxActiveProcesses uint32
+}
+
+// extendedLimitInfo builds the JobObjectExtendedLimitInformation for
+// limits, and whether it needs to be set at all (a job created with
+// JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE already has no other limits, so
+// there's nothing to do when limits specifies none of these either).
+// Split out from ApplySandboxLimits so the flag-combination logic can
+// be unit-tested without a real job object handle.
+func extendedLimitInfo(limits SandboxLimits) (syscallex.JobObjectExtendedLimitInformation, bool) {
+	if limits.JobMemoryBytes == 0 && limits.ProcessMemoryBytes == 0 && limits.MaxActiveProcesses == 0 {
+		return syscallex.JobObjectExtendedLimitInformation{}, false
+	}
+
+	info := syscallex.JobObjectExtendedLimitInformation{
+		BasicLimitInformation: syscallex.JobObjectBasicLimitInformation{
+			LimitFlags: syscallex.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+
+	if limits.JobMemoryBytes > 0 {
+		info.BasicLimitInformation.LimitFlags |= syscallex.JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr(limits.JobMemoryBytes)
+	}
+
+	if limits.ProcessMemoryBytes > 0 {
+		info.BasicLimitInformation.LimitFlags |= syscallex.JOB_OBJECT_LIMIT_PROCESS_MEMORY
+		info.ProcessMemoryLimit = uintptr(limits.ProcessMemoryBytes)
+	}
+
+	if limits.MaxActiveProcesses > 0 {
+		info.BasicLimitInformation.LimitFlags |= syscallex.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		info.BasicLimitInformation.ActiveProcessLimit = limits.MaxActiveProcesses
+	}
+
+	return info, true
+}
+
+// cpuRateControlInfo builds the JobObjectCpuRateControlInformation for
+// limits, and whether a CPU cap was requested at all.
+func cpuRateControlInfo(limits SandboxLimits) (syscallex.JobObjectCpuRateControlInformation, bool) {
+	if limits.CPUPercent <= 0 {
+		return syscallex.JobObjectCpuRateControlInformation{}, false
+	}
+
+	return syscallex.JobObjectCpuRateControlInformation{
+		ControlFlags: syscallex.JOB_OBJECT_CPU_RATE_CONTROL_ENABLE | syscallex.JOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP,
+		CpuRate:      uint32(limits.CPUPercent) * 100,
+	}, true
+}
+
+// uiRestrictionsInfo builds the JobObjectBasicUiRestrictions for
+// limits, and whether any UI restriction was requested at all.
+func uiRestrictionsInfo(limits SandboxLimits) (syscallex.JobObjectBasicUiRestrictions, bool) {
+	if !limits.DisableClipboardWrite {
+		return syscallex.JobObjectBasicUiRestrictions{}, false
+	}
+
+	return syscallex.JobObjectBasicUiRestrictions{
+		UIRestrictionsClass: syscallex.JOB_OBJECT_UILIMIT_WRITECLIPBOARD,
+	}, true
+}
+
+// ApplySandboxLimits configures jobObject to enforce limits, on top of
+// the JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE flag already set when the job
+// was created.
+func ApplySandboxLimits(jobObject syscall.Handle, limits SandboxLimits) error {
+	if info, ok := extendedLimitInfo(limits); ok {
+		err := syscallex.SetInformationJobObject(
+			jobObject,
+			syscallex.JobObjectInfoClass_JobObjectExtendedLimitInformation,
+			uintptr(unsafe.Pointer(&info)),
+			unsafe.Sizeof(info),
+		)
+		if err != nil {
+			return fmt.Errorf("setting job object extended limits: %w", err)
+		}
+	}
+
+	if cpuInfo, ok := cpuRateControlInfo(limits); ok {
+		err := syscallex.SetInformationJobObject(
+			jobObject,
+			syscallex.JobObjectInfoClass_JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&cpuInfo)),
+			unsafe.Sizeof(cpuInfo),
+		)
+		if err != nil {
+			return fmt.Errorf("setting job object CPU rate: %w", err)
+		}
+	}
+
+	if uiInfo, ok := uiRestrictionsInfo(limits); ok {
+		err := syscallex.SetInformationJobObject(
+			jobObject,
+			syscallex.JobObjectInfoClass_JobObjectBasicUIRestrictions,
+			uintptr(unsafe.Pointer(&uiInfo)),
+			unsafe.Sizeof(uiInfo),
+		)
+		if err != nil {
+			return fmt.Errorf("setting job object UI restrictions: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// JobObjectStats reports the peak memory and IO counters for a job
+// object, as shown by the `launch` command once the game exits.
+type JobObjectStats struct {
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+	IoCounters            syscallex.IoCounters
+}
+
+// QuerySandboxStats reads back the extended limit information of
+// jobObject to report its peak memory usage and IO counters.
+func QuerySandboxStats(jobObject syscall.Handle) (*JobObjectStats, error) {
+	var info syscallex.JobObjectExtendedLimitInformation
+
+	err := syscallex.QueryInformationJobObject(
+		jobObject,
+		syscallex.JobObjectInfoClass_JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		unsafe.Sizeof(info),
+		0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying job object extended limits: %w", err)
+	}
+
+	return &JobObjectStats{
+		PeakProcessMemoryUsed: info.PeakProcessMemoryUsed,
+		PeakJobMemoryUsed:     info.PeakJobMemoryUsed,
+		IoCounters:            info.IoInfo,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/itchio/butler/runner/syscallex"
+)
+
+func TestExtendedLimitInfoNoLimitsIsNoOp(t *testing.T) {
+	_, ok := extendedLimitInfo(SandboxLimits{})
+	if ok {
+		t.Fatalf("expected no extended limit info when nothing is set")
+	}
+}
+
+func TestExtendedLimitInfoAlwaysKillsOnJobClose(t *testing.T) {
+	info, ok := extendedLimitInfo(SandboxLimits{MaxActiveProcesses: 4})
+	if !ok {
+		t.Fatalf("expected extended limit info when MaxActiveProcesses is set")
+	}
+	if info.BasicLimitInformation.LimitFlags&syscallex.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE == 0 {
+		t.Fatalf("expected KILL_ON_JOB_CLOSE to always be set, got flags %x", info.BasicLimitInformation.LimitFlags)
+	}
+}
+
+func TestExtendedLimitInfoJobAndProcessMemoryAreIndependent(t *testing.T) {
+	info, ok := extendedLimitInfo(SandboxLimits{JobMemoryBytes: 100, ProcessMemoryBytes: 50})
+	if !ok {
+		t.Fatalf("expected extended limit info")
+	}
+
+	wantFlags := uint32(syscallex.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE | syscallex.JOB_OBJECT_LIMIT_JOB_MEMORY | syscallex.JOB_OBJECT_LIMIT_PROCESS_MEMORY)
+	if info.BasicLimitInformation.LimitFlags != wantFlags {
+		t.Fatalf("expected flags %x, got %x", wantFlags, info.BasicLimitInformation.LimitFlags)
+	}
+	if info.JobMemoryLimit != 100 {
+		t.Fatalf("expected JobMemoryLimit 100, got %d", info.JobMemoryLimit)
+	}
+	if info.ProcessMemoryLimit != 50 {
+		t.Fatalf("expected ProcessMemoryLimit 50, got %d", info.ProcessMemoryLimit)
+	}
+}
+
+func TestExtendedLimitInfoMaxActiveProcesses(t *testing.T) {
+	info, ok := extendedLimitInfo(SandboxLimits{MaxActiveProcesses: 7})
+	if !ok {
+		t.Fatalf("expected extended limit info")
+	}
+	if info.BasicLimitInformation.LimitFlags&syscallex.JOB_OBJECT_LIMIT_ACTIVE_PROCESS == 0 {
+		t.Fatalf("expected ACTIVE_PROCESS flag to be set")
+	}
+	if info.BasicLimitInformation.ActiveProcessLimit != 7 {
+		t.Fatalf("expected ActiveProcessLimit 7, got %d", info.BasicLimitInformation.ActiveProcessLimit)
+	}
+}
+
+func TestCPURateControlInfo(t *testing.T) {
+	if _, ok := cpuRateControlInfo(SandboxLimits{}); ok {
+		t.Fatalf("expected no CPU rate control info when CPUPercent is unset")
+	}
+
+	info, ok := cpuRateControlInfo(SandboxLimits{CPUPercent: 50})
+	if !ok {
+		t.Fatalf("expected CPU rate control info when CPUPercent is set")
+	}
+	if info.CpuRate != 5000 {
+		t.Fatalf("expected CpuRate 5000 (50%% in hundredths of a percent), got %d", info.CpuRate)
+	}
+	wantFlags := uint32(syscallex.JOB_OBJECT_CPU_RATE_CONTROL_ENABLE | syscallex.JOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP)
+	if info.ControlFlags != wantFlags {
+		t.Fatalf("expected ControlFlags %x, got %x", wantFlags, info.ControlFlags)
+	}
+}
+
+func TestUIRestrictionsInfo(t *testing.T) {
+	if _, ok := uiRestrictionsInfo(SandboxLimits{}); ok {
+		t.Fatalf("expected no UI restrictions when DisableClipboardWrite is false")
+	}
+
+	info, ok := uiRestrictionsInfo(SandboxLimits{DisableClipboardWrite: true})
+	if !ok {
+		t.Fatalf("expected UI restrictions when DisableClipboardWrite is true")
+	}
+	if info.UIRestrictionsClass != syscallex.JOB_OBJECT_UILIMIT_WRITECLIPBOARD {
+		t.Fatalf("expected WRITECLIPBOARD restriction, got %x", info.UIRestrictionsClass)
+	}
+}
@@ -9,13 +9,37 @@ import (
 
 // JobObjectInfoClass
 const (
-	JobObjectInfoClass_JobObjectBasicProcessIdList       = 3
-	JobObjectInfoClass_JobObjectExtendedLimitInformation = 9
+	JobObjectInfoClass_JobObjectBasicProcessIdList        = 3
+	JobObjectInfoClass_JobObjectExtendedLimitInformation  = 9
+	JobObjectInfoClass_JobObjectCpuRateControlInformation = 15
+	JobObjectInfoClass_JobObjectBasicUIRestrictions       = 4
+	JobObjectInfoClass_JobObjectBasicLimitInformation     = 2
 )
 
 // JobObjectBasicLimitInformation.LimitFlags
 const (
 	JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE = 0x00002000
+	JOB_OBJECT_LIMIT_JOB_MEMORY        = 0x00000200
+	JOB_OBJECT_LIMIT_PROCESS_MEMORY    = 0x00000100
+	JOB_OBJECT_LIMIT_ACTIVE_PROCESS    = 0x00000008
+)
+
+// JobObjectBasicUIRestrictions.UIRestrictionsClass
+const (
+	JOB_OBJECT_UILIMIT_HANDLES          = 0x00000001
+	JOB_OBJECT_UILIMIT_READCLIPBOARD    = 0x00000002
+	JOB_OBJECT_UILIMIT_WRITECLIPBOARD   = 0x00000004
+	JOB_OBJECT_UILIMIT_SYSTEMPARAMETERS = 0x00000008
+	JOB_OBJECT_UILIMIT_DISPLAYSETTINGS  = 0x00000010
+	JOB_OBJECT_UILIMIT_GLOBALATOMS      = 0x00000020
+	JOB_OBJECT_UILIMIT_DESKTOP          = 0x00000040
+	JOB_OBJECT_UILIMIT_EXITWINDOWS      = 0x00000080
+)
+
+// JobObjectCpuRateControlInformation.ControlFlags
+const (
+	JOB_OBJECT_CPU_RATE_CONTROL_ENABLE   = 0x00000001
+	JOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP = 0x00000004
 )
 
 const (
@@ -83,6 +107,40 @@ type IoCounters struct {
 	OtherTransferCount  uint64
 }
 
+type JobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type JobObjectExtendedLimitInformation struct {
+	BasicLimitInformation JobObjectBasicLimitInformation
+	IoInfo                IoCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// JobObjectCpuRateControlInformation mirrors JOBOBJECT_CPU_RATE_CONTROL_INFORMATION.
+// CpuRate is expressed in units of 1/100 of a percent (so 100% is 10000),
+// and is only meaningful when ControlFlags has
+// JOB_OBJECT_CPU_RATE_CONTROL_ENABLE and JOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP set.
+type JobObjectCpuRateControlInformation struct {
+	ControlFlags uint32
+	CpuRate      uint32
+}
+
+type JobObjectBasicUiRestrictions struct {
+	UIRestrictionsClass uint32
+}
+
 func SetInformationJobObject(
 	jobObject syscall.Handle,
 	jobObjectInfoClass uint32,
@@ -0,0 +1,192 @@
+// Package sigcache implements a small content-addressable cache that
+// lets `butler diff` skip recomputing a signature (and re-uploading
+// identical patch blocks) for inputs it has already seen, the same way
+// a docker registry client skips a GET when a HEAD's digest matches
+// what's already cached locally.
+package sigcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+	"github.com/itchio/wharf/pwr"
+)
+
+// magic and version identify the bucket format stored in the cache
+// database, so future butler versions can tell whether they can read
+// (or must discard) an older cache.
+const magic = "butler-sigcache"
+const version = 1
+
+var signaturesBucket = []byte("signatures")
+var metaBucket = []byte("meta")
+
+// DefaultDir returns the default location for the signature cache,
+// `itch/butler/sigcache` under os.UserConfigDir (so
+// `~/.config/itch/butler/sigcache` on Linux).
+func DefaultDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "itch", "butler", "sigcache"), nil
+}
+
+// Cache is a persistent store of weak key -> pwr.SignatureInfo entries.
+type Cache struct {
+	db *bolt.DB
+}
+
+// Open opens (creating if necessary) the signature cache database
+// rooted at dir.
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating sig-cache dir: %w", err)
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, "sigcache.db"), 0644, &bolt.Options{
+		Timeout: 2 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening sig-cache: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(signaturesBucket); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		storedMagic := meta.Get([]byte("magic"))
+		if storedMagic == nil {
+			return writeHeader(meta)
+		}
+
+		if string(storedMagic) != magic {
+			return fmt.Errorf("sig-cache: not a butler sig-cache (bad magic)")
+		}
+
+		storedVersion := meta.Get([]byte("version"))
+		if len(storedVersion) != 1 || storedVersion[0] != version {
+			// an older (or newer) butler wrote this cache in a format we
+			// don't know how to read: the cached signatures are just an
+			// optimization, so the safe move is to wipe them and start
+			// fresh under the current version rather than fail outright.
+			if err := tx.DeleteBucket(signaturesBucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(signaturesBucket); err != nil {
+				return err
+			}
+			return writeHeader(meta)
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing sig-cache: %w", err)
+	}
+
+	return &Cache{db: db}, nil
+}
+
+// writeHeader stamps meta with the current magic and version, for a
+// freshly created cache or one just wiped after a version mismatch.
+func writeHeader(meta *bolt.Bucket) error {
+	if err := meta.Put([]byte("magic"), []byte(magic)); err != nil {
+		return err
+	}
+	return meta.Put([]byte("version"), []byte{version})
+}
+
+// Close releases the underlying database file.
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+type entry struct {
+	StoredAt  time.Time
+	Signature *pwr.SignatureInfo
+}
+
+// Get returns the cached signature for weakKey, if any.
+func (c *Cache) Get(weakKey string) (*pwr.SignatureInfo, bool) {
+	var e entry
+	found := false
+
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(signaturesBucket).Get([]byte(weakKey))
+		if raw == nil {
+			return nil
+		}
+		if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&e); err != nil {
+			return nil
+		}
+		found = true
+		return nil
+	})
+
+	if !found {
+		return nil, false
+	}
+	return e.Signature, true
+}
+
+// Put stores sig under weakKey, overwriting any previous entry.
+func (c *Cache) Put(weakKey string, sig *pwr.SignatureInfo) error {
+	e := entry{
+		StoredAt:  time.Now(),
+		Signature: sig,
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&e); err != nil {
+		return fmt.Errorf("encoding sig-cache entry: %w", err)
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(signaturesBucket).Put([]byte(weakKey), buf.Bytes())
+	})
+}
+
+// GC evicts entries that were stored more than maxAge ago.
+func (c *Cache) GC(maxAge time.Duration) error {
+	cutoff := time.Now().Add(-maxAge)
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(signaturesBucket)
+		var stale [][]byte
+
+		err := bucket.ForEach(func(k, v []byte) error {
+			var e entry
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&e); err != nil {
+				// can't decode it, it's not doing anyone any good either
+				stale = append(stale, append([]byte(nil), k...))
+				return nil
+			}
+			if e.StoredAt.Before(cutoff) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,180 @@
+package sigcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+	"github.com/itchio/wharf/pwr"
+	"github.com/itchio/wharf/tlc"
+)
+
+func openTestCache(t *testing.T) (*Cache, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "sigcache")
+	if err != nil {
+		t.Fatalf("making temp dir: %s", err.Error())
+	}
+
+	cache, err := Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Open: %s", err.Error())
+	}
+
+	return cache, dir
+}
+
+func TestOpenWritesAndValidatesHeader(t *testing.T) {
+	cache, dir := openTestCache(t)
+	defer os.RemoveAll(dir)
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+
+	// reopening the same directory should succeed, validating the
+	// header this time instead of writing it
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("re-Open: %s", err.Error())
+	}
+	defer reopened.Close()
+}
+
+func TestOpenRejectsBadMagic(t *testing.T) {
+	cache, dir := openTestCache(t)
+	defer os.RemoveAll(dir)
+
+	err := cache.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put([]byte("magic"), []byte("not-a-butler-cache"))
+	})
+	if err != nil {
+		t.Fatalf("corrupting magic: %s", err.Error())
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+
+	if _, err := Open(dir); err == nil {
+		t.Fatalf("expected Open to reject a cache with a bad magic header")
+	}
+}
+
+func TestOpenWipesEntriesOnVersionMismatch(t *testing.T) {
+	cache, dir := openTestCache(t)
+	defer os.RemoveAll(dir)
+
+	sig := &pwr.SignatureInfo{Container: &tlc.Container{}}
+	if err := cache.Put("some-key", sig); err != nil {
+		t.Fatalf("Put: %s", err.Error())
+	}
+
+	err := cache.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put([]byte("version"), []byte{version + 1})
+	})
+	if err != nil {
+		t.Fatalf("bumping version: %s", err.Error())
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("re-Open after version bump: %s", err.Error())
+	}
+	defer reopened.Close()
+
+	if _, ok := reopened.Get("some-key"); ok {
+		t.Fatalf("expected entries to be wiped after a version mismatch")
+	}
+
+	// and the header should have been rewritten to the current version,
+	// so a subsequent open doesn't wipe again
+	var storedVersion []byte
+	err = reopened.db.View(func(tx *bolt.Tx) error {
+		storedVersion = append([]byte(nil), tx.Bucket(metaBucket).Get([]byte("version"))...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading version: %s", err.Error())
+	}
+	if len(storedVersion) != 1 || storedVersion[0] != version {
+		t.Fatalf("expected the header to be rewritten to version %d, got %v", version, storedVersion)
+	}
+	if err := reopened.Put("some-key", sig); err != nil {
+		t.Fatalf("Put after rewrite: %s", err.Error())
+	}
+	if _, ok := reopened.Get("some-key"); !ok {
+		t.Fatalf("expected the cache to be usable again after rewriting the header")
+	}
+}
+
+func TestGetPutRoundTrip(t *testing.T) {
+	cache, dir := openTestCache(t)
+	defer os.RemoveAll(dir)
+	defer cache.Close()
+
+	if _, ok := cache.Get("missing"); ok {
+		t.Fatalf("expected a miss for a key that was never stored")
+	}
+
+	sig := &pwr.SignatureInfo{Container: &tlc.Container{Size: 42}}
+	if err := cache.Put("present", sig); err != nil {
+		t.Fatalf("Put: %s", err.Error())
+	}
+
+	got, ok := cache.Get("present")
+	if !ok {
+		t.Fatalf("expected a hit for a key that was stored")
+	}
+	if got.Container.Size != 42 {
+		t.Fatalf("expected round-tripped signature to preserve its container, got size %d", got.Container.Size)
+	}
+}
+
+func TestGCEvictsOldAndUndecodableEntries(t *testing.T) {
+	cache, dir := openTestCache(t)
+	defer os.RemoveAll(dir)
+	defer cache.Close()
+
+	sig := &pwr.SignatureInfo{Container: &tlc.Container{}}
+	if err := cache.Put("fresh", sig); err != nil {
+		t.Fatalf("Put fresh: %s", err.Error())
+	}
+
+	stale := entry{StoredAt: time.Now().Add(-48 * time.Hour), Signature: sig}
+	var staleBuf bytes.Buffer
+	if err := gob.NewEncoder(&staleBuf).Encode(&stale); err != nil {
+		t.Fatalf("encoding stale entry: %s", err.Error())
+	}
+
+	err := cache.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(signaturesBucket)
+		if err := bucket.Put([]byte("stale"), staleBuf.Bytes()); err != nil {
+			return err
+		}
+		return bucket.Put([]byte("garbage"), []byte("not a valid gob stream"))
+	})
+	if err != nil {
+		t.Fatalf("seeding stale/garbage entries: %s", err.Error())
+	}
+
+	if err := cache.GC(24 * time.Hour); err != nil {
+		t.Fatalf("GC: %s", err.Error())
+	}
+
+	if _, ok := cache.Get("fresh"); !ok {
+		t.Fatalf("expected GC to keep a fresh entry")
+	}
+	if _, ok := cache.Get("stale"); ok {
+		t.Fatalf("expected GC to evict an entry older than maxAge")
+	}
+	if _, ok := cache.Get("garbage"); ok {
+		t.Fatalf("expected GC to evict an entry that can't be decoded")
+	}
+}
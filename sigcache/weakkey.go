@@ -0,0 +1,68 @@
+package sigcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+const sampleSize = 4096
+
+// WeakKey hashes a file's path, size, mtime and its first and last
+// sampleSize bytes into a short key that's cheap to compute, so
+// ComputeSignature can be skipped whenever it's unchanged.
+func WeakKey(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, stat.Size(), stat.ModTime().UnixNano())
+
+	head := make([]byte, sampleSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	h.Write(head[:n])
+
+	if stat.Size() > sampleSize {
+		tail := make([]byte, sampleSize)
+		if _, err := f.Seek(-sampleSize, io.SeekEnd); err != nil {
+			return "", err
+		}
+		n, err := io.ReadFull(f, tail)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return "", err
+		}
+		h.Write(tail[:n])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ContainerKey combines the paths and weak keys of the files at paths,
+// in the given order, into a single key for the whole signature, so a
+// cache entry can be looked up (or stored) for the container as a whole.
+func ContainerKey(paths []string) (string, error) {
+	h := sha256.New()
+
+	for _, p := range paths {
+		key, err := WeakKey(p)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", p, key)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,125 @@
+package sigcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("writing %s: %s", path, err.Error())
+	}
+}
+
+func TestWeakKeyStableForUnchangedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigcache-weakkey")
+	if err != nil {
+		t.Fatalf("making temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.txt")
+	writeFile(t, path, "hello world")
+
+	first, err := WeakKey(path)
+	if err != nil {
+		t.Fatalf("WeakKey: %s", err.Error())
+	}
+
+	second, err := WeakKey(path)
+	if err != nil {
+		t.Fatalf("WeakKey: %s", err.Error())
+	}
+
+	if first != second {
+		t.Fatalf("expected WeakKey to be stable for an unchanged file, got %q then %q", first, second)
+	}
+}
+
+func TestWeakKeyChangesWithContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigcache-weakkey")
+	if err != nil {
+		t.Fatalf("making temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.txt")
+	writeFile(t, path, "hello world")
+
+	before, err := WeakKey(path)
+	if err != nil {
+		t.Fatalf("WeakKey: %s", err.Error())
+	}
+
+	writeFile(t, path, "goodbye world")
+	// force a different mtime even if the filesystem's clock resolution
+	// is coarse
+	future := time.Now().Add(1 * time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Chtimes: %s", err.Error())
+	}
+
+	after, err := WeakKey(path)
+	if err != nil {
+		t.Fatalf("WeakKey: %s", err.Error())
+	}
+
+	if before == after {
+		t.Fatalf("expected WeakKey to change when content changes, got %q both times", before)
+	}
+}
+
+func TestWeakKeyHandlesFilesSmallerThanSampleSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigcache-weakkey")
+	if err != nil {
+		t.Fatalf("making temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tiny.txt")
+	writeFile(t, path, "x")
+
+	if _, err := WeakKey(path); err != nil {
+		t.Fatalf("WeakKey on a file smaller than sampleSize: %s", err.Error())
+	}
+}
+
+func TestContainerKeyOrderSensitive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigcache-containerkey")
+	if err != nil {
+		t.Fatalf("making temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	pathA := filepath.Join(dir, "a.txt")
+	pathB := filepath.Join(dir, "b.txt")
+	writeFile(t, pathA, "aaa")
+	writeFile(t, pathB, "bbb")
+
+	forward, err := ContainerKey([]string{pathA, pathB})
+	if err != nil {
+		t.Fatalf("ContainerKey: %s", err.Error())
+	}
+
+	backward, err := ContainerKey([]string{pathB, pathA})
+	if err != nil {
+		t.Fatalf("ContainerKey: %s", err.Error())
+	}
+
+	if forward == backward {
+		t.Fatalf("expected ContainerKey to be sensitive to file order")
+	}
+
+	again, err := ContainerKey([]string{pathA, pathB})
+	if err != nil {
+		t.Fatalf("ContainerKey: %s", err.Error())
+	}
+
+	if forward != again {
+		t.Fatalf("expected ContainerKey to be stable across calls, got %q then %q", forward, again)
+	}
+}